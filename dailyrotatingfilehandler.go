@@ -0,0 +1,191 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RotateRule decides when a DailyRotatingFileHandler's active file should
+// be rotated and what happens to it afterwards. Hourly or weekly rules
+// can be plugged in by implementing the same interface.
+type RotateRule interface {
+	ShallRotate() bool
+	BackupFileName() string
+	MarkRotated()
+	OutdatedFiles() []string
+}
+
+type dailyRotateRule struct {
+	filePath  string
+	keepDays  int
+	rotatedAt time.Time
+}
+
+func (r *dailyRotateRule) ShallRotate() bool {
+	now := time.Now()
+	return now.Year() != r.rotatedAt.Year() || now.YearDay() != r.rotatedAt.YearDay()
+}
+
+func (r *dailyRotateRule) BackupFileName() string {
+	return fmt.Sprintf("%s-%s", r.filePath, r.rotatedAt.Format("2006-01-02"))
+}
+
+func (r *dailyRotateRule) MarkRotated() {
+	r.rotatedAt = time.Now()
+}
+
+func (r *dailyRotateRule) OutdatedFiles() []string {
+	matches, err := filepath.Glob(r.filePath + "-*")
+	if err != nil {
+		return nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -r.keepDays)
+	var outdated []string
+	for _, m := range matches {
+		fileinfo, err := os.Stat(m)
+		if err != nil {
+			continue
+		}
+		if fileinfo.ModTime().Before(cutoff) {
+			outdated = append(outdated, m)
+		}
+	}
+	return outdated
+}
+
+type DailyRotatingFileHandler struct {
+	FileHandler
+	rule     RotateRule
+	compress bool
+	fileLock *sync.RWMutex
+	running  bool
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// Log only formats the message and enqueues it; the write happens on
+// the writer goroutine started by Run.
+func (dfh *DailyRotatingFileHandler) Log(format string, v ...interface{}) {
+	dfh.Write([]byte(fmt.Sprintf(format, v...)))
+}
+
+// Write enqueues an already-formatted line, letting a Logger with
+// several handlers format a message once instead of once per handler.
+func (dfh *DailyRotatingFileHandler) Write(b []byte) {
+	dfh.fileLock.RLock()
+	off := dfh.log == nil
+	dfh.fileLock.RUnlock()
+	if off {
+		return
+	}
+	dfh.queue.enqueue(append([]byte(nil), b...))
+}
+
+func (dfh *DailyRotatingFileHandler) Run() {
+	dfh.running = true
+	dfh.queue.doneWG.Add(1)
+	go func() {
+		defer dfh.queue.doneWG.Done()
+		dfh.runWriter()
+	}()
+	go dfh.loop()
+}
+
+func (dfh *DailyRotatingFileHandler) runWriter() {
+	for b := range dfh.queue.ch {
+		dfh.fileLock.RLock()
+		dfh.log.Print(string(b))
+		dfh.fileLock.RUnlock()
+	}
+	dfh.fileLock.RLock()
+	dfh.fileFd.Sync()
+	dfh.fileLock.RUnlock()
+}
+
+func (dfh *DailyRotatingFileHandler) Close() error {
+	dfh.doneOnce.Do(func() {
+		dfh.running = false
+		close(dfh.done)
+	})
+	dfh.drain()
+	dfh.compressor.wg.Wait()
+	dfh.fileLock.Lock()
+	defer dfh.fileLock.Unlock()
+	return dfh.FileHandler.Close()
+}
+
+func (dfh *DailyRotatingFileHandler) loop() {
+	for {
+		timer := time.NewTimer(dfh.nextBoundary())
+		select {
+		case <-timer.C:
+			dfh.rotate()
+		case <-dfh.done:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (dfh *DailyRotatingFileHandler) nextBoundary() time.Duration {
+	now := time.Now()
+	next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	return next.Sub(now)
+}
+
+func (dfh *DailyRotatingFileHandler) rotate() {
+	if !dfh.rule.ShallRotate() {
+		return
+	}
+
+	dfh.fileLock.Lock()
+	flag := dfh.log.Flags()
+	dfh.fileFd.Close()
+	backupPath := dfh.rule.BackupFileName()
+	os.Rename(dfh.filePath, backupPath)
+	dfh.fileFd, _ = os.OpenFile(dfh.filePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	dfh.log = log.New(dfh.fileFd, "", flag)
+	dfh.rule.MarkRotated()
+	dfh.fileLock.Unlock()
+
+	if dfh.compress {
+		dfh.startCompress(backupPath)
+	}
+
+	for _, outdated := range dfh.rule.OutdatedFiles() {
+		os.Remove(outdated)
+	}
+}
+
+// NewDailyRotatingFileHandler builds a Handler that rotates filePath onto
+// a daily boundary, keeping keepDays worth of backups. When compress is
+// true, each backup is gzipped in the background via the same pipeline
+// SizeRotatingFileHandler uses (see FileHandler.compressToGz).
+func NewDailyRotatingFileHandler(name string, filePath string, keepDays int, compress bool) (*DailyRotatingFileHandler, error) {
+	fh, err := NewFileHandler(name, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	rotatedAt := time.Now()
+	if fileinfo, err := os.Stat(filePath); err == nil {
+		rotatedAt = fileinfo.ModTime()
+	}
+
+	dfh := &DailyRotatingFileHandler{
+		FileHandler: *fh,
+		rule: &dailyRotateRule{
+			filePath:  filePath,
+			keepDays:  keepDays,
+			rotatedAt: rotatedAt,
+		},
+		compress: compress,
+		fileLock: new(sync.RWMutex),
+		done:     make(chan struct{}),
+	}
+	return dfh, nil
+}
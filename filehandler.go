@@ -1,6 +1,9 @@
 package logging
 
 import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
 	"os"
 	"fmt"
 	"log"
@@ -10,36 +13,71 @@ import (
 )
 
 type FileHandler struct {
-	name     string
-	off      bool
-	filePath string
-	fileFd   *os.File
-	log      *log.Logger
+	name       string
+	off        bool
+	filePath   string
+	fileFd     *os.File
+	log        *log.Logger
+	queue      *writeQueue
+	refCounter *refCounter
+	compressor *compressor
 }
 
-func (fh FileHandler) Log(format string, v ...interface{}) {
-	if fh.log != nil {
-		fh.log.Printf(format, v...)
-	}
+// Log only formats the message; the write itself happens on the
+// handler's writer goroutine (started by Run) so the caller never
+// blocks on file I/O.
+func (fh *FileHandler) Log(format string, v ...interface{}) {
+	fh.Write([]byte(fmt.Sprintf(format, v...)))
+}
+
+// Write enqueues an already-formatted line, letting a Logger with
+// several handlers format a message once instead of once per handler.
+// The queue itself rejects writes once Close has started, so this can't
+// race fh.log being cleared out from under a concurrent Close.
+func (fh *FileHandler) Write(b []byte) {
+	fh.queue.enqueue(append([]byte(nil), b...))
 }
 
 func (fh *FileHandler) Off() {
 	fh.off = true
 }
 
-func (fh FileHandler) IsOff() bool {
+func (fh *FileHandler) IsOff() bool {
 	return fh.off
 }
 
 func (fh *FileHandler) Run() {
-	return
+	fh.queue.doneWG.Add(1)
+	go func() {
+		defer fh.queue.doneWG.Done()
+		fh.runWriter()
+	}()
+}
+
+func (fh *FileHandler) runWriter() {
+	for b := range fh.queue.ch {
+		fh.log.Print(string(b))
+	}
+	fh.fileFd.Sync()
 }
 
-func (fh FileHandler) Name() string {
+// drain closes the write queue and waits for the writer goroutine to
+// flush whatever was still buffered.
+func (fh *FileHandler) drain() {
+	fh.queue.close()
+	fh.queue.doneWG.Wait()
+}
+
+func (fh *FileHandler) Name() string {
 	return fh.name
 }
 
+func (fh *FileHandler) Stats() HandlerStats {
+	return fh.queue.stats()
+}
+
 func (fh *FileHandler) Close() error {
+	fh.drain()
 	fh.name = ""
 	fh.off = true
 	fh.log = nil
@@ -55,6 +93,17 @@ func (fh *FileHandler) SetFlags(flag int) {
 	fh.log.SetFlags(flag)
 }
 
+// SetQueueSize overrides the default buffered-channel size. Call it
+// before Run starts the writer goroutine.
+func (fh *FileHandler) SetQueueSize(n int) {
+	fh.queue = newWriteQueue(n, fh.queue.policy)
+}
+
+// SetOverflowPolicy chooses what happens once the write queue is full.
+func (fh *FileHandler) SetOverflowPolicy(p OverflowPolicy) {
+	fh.queue.policy = p
+}
+
 func NewFileHandler(name string, filePath string) (*FileHandler, error) {
 	if filePath == "" {
 		return nil, fmt.Errorf("handler filePath is null.")
@@ -70,14 +119,148 @@ func NewFileHandler(name string, filePath string) (*FileHandler, error) {
 	}
 
 	return &FileHandler{
-		name:     name,
-		off:      false,
-		filePath: filePath,
-		fileFd:   fileFd,
-		log:      log.New(fileFd, "", DEFLOGFLAG),
+		name:       name,
+		off:        false,
+		filePath:   filePath,
+		fileFd:     fileFd,
+		log:        log.New(fileFd, "", DEFLOGFLAG),
+		queue:      newWriteQueue(DefaultQueueSize, DropOldest),
+		refCounter: newRefCounter(),
+		compressor: newCompressor(),
 	}, nil
 }
 
+// compressor gzips rotated-out files in the background on behalf of any
+// Handler that embeds FileHandler, giving SizeRotatingFileHandler and
+// DailyRotatingFileHandler the same per-file mutex, ref-counting, and
+// last-write metadata instead of each hand-rolling its own.
+type compressor struct {
+	lock    sync.Mutex
+	mutexes map[string]*sync.Mutex
+	wg      sync.WaitGroup
+}
+
+func newCompressor() *compressor {
+	return &compressor{mutexes: make(map[string]*sync.Mutex)}
+}
+
+// pathMutex returns the mutex guarding compression of path, creating it
+// on first use so concurrent rotations of the same file never race.
+func (c *compressor) pathMutex(path string) *sync.Mutex {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	mu, ok := c.mutexes[path]
+	if !ok {
+		mu = new(sync.Mutex)
+		c.mutexes[path] = mu
+	}
+	return mu
+}
+
+// compressToGz gzips srcPath to srcPath+".gz" and removes srcPath. It
+// writes to a temp name and renames into place so the .gz only ever
+// appears atomically, never as a partial file a reader's glob could
+// pick up mid-write. srcPath itself is ref-counted so a reader that's
+// mid-tail on the plain file (see tailFile) never has it deleted out
+// from under it.
+func (fh *FileHandler) compressToGz(srcPath string) {
+	mu := fh.compressor.pathMutex(srcPath)
+	mu.Lock()
+	defer mu.Unlock()
+
+	dstPath := srcPath + ".gz"
+	tmpPath := dstPath + ".tmp"
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return
+	}
+
+	gw := gzip.NewWriter(dst)
+	if extra, err := json.Marshal(struct {
+		LastWrite int64 `json:"last_write"`
+	}{LastWrite: time.Now().Unix()}); err == nil {
+		gw.Header.Extra = extra
+	}
+
+	if _, err := io.Copy(gw, src); err != nil {
+		gw.Close()
+		dst.Close()
+		os.Remove(tmpPath)
+		return
+	}
+	if err := gw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+
+	src.Close()
+	if fh.refCounter.inUse(srcPath) {
+		return
+	}
+	os.Remove(srcPath)
+}
+
+// startCompress runs compressToGz(srcPath) on a tracked background
+// goroutine so Close can wait for any in-flight compression to finish.
+func (fh *FileHandler) startCompress(srcPath string) {
+	fh.compressor.wg.Add(1)
+	go func() {
+		defer fh.compressor.wg.Done()
+		fh.compressToGz(srcPath)
+	}()
+}
+
+// refCounter tracks how many consumers are currently reading a rotated
+// file so that compression (or a future cleanup pass) never touches a
+// file out from under a reader.
+type refCounter struct {
+	lock   sync.Mutex
+	counts map[string]int
+}
+
+func newRefCounter() *refCounter {
+	return &refCounter{counts: make(map[string]int)}
+}
+
+func (rc *refCounter) acquire(name string) {
+	rc.lock.Lock()
+	rc.counts[name]++
+	rc.lock.Unlock()
+}
+
+func (rc *refCounter) release(name string) {
+	rc.lock.Lock()
+	if rc.counts[name] > 0 {
+		rc.counts[name]--
+		if rc.counts[name] == 0 {
+			delete(rc.counts, name)
+		}
+	}
+	rc.lock.Unlock()
+}
+
+func (rc *refCounter) inUse(name string) bool {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	return rc.counts[name] > 0
+}
+
 type SizeRotatingFileHandler struct {
 	FileHandler
 	fileCount  int
@@ -86,38 +269,67 @@ type SizeRotatingFileHandler struct {
 	nextSuffix int
 	running    bool
 	rotatingLock *sync.RWMutex
-	rotatingRun bool
+	nextCheckAt time.Time
 	rotatingInterval int
+	compress         bool
 }
 
+// Log only formats the message and enqueues it; the write and the
+// inline size check both happen on the writer goroutine started by Run.
 func (srfh *SizeRotatingFileHandler) Log(format string, v ...interface{}) {
-	if srfh.log != nil {
-		srfh.fileLock.RLock()
-		srfh.log.Printf(format, v...)
-		srfh.fileLock.RUnlock()
-		go srfh.rotating()
+	srfh.Write([]byte(fmt.Sprintf(format, v...)))
+}
+
+// Write enqueues an already-formatted line, letting a Logger with
+// several handlers format a message once instead of once per handler.
+func (srfh *SizeRotatingFileHandler) Write(b []byte) {
+	srfh.fileLock.RLock()
+	off := srfh.log == nil
+	srfh.fileLock.RUnlock()
+	if off {
+		return
 	}
+	srfh.queue.enqueue(append([]byte(nil), b...))
 }
 
 func (srfh *SizeRotatingFileHandler) Off() {
 	srfh.off = true
 }
 
-func (srfh SizeRotatingFileHandler) IsOff() bool {
+func (srfh *SizeRotatingFileHandler) IsOff() bool {
 	return srfh.off
 }
 
 func (srfh *SizeRotatingFileHandler) Run() {
 	srfh.running = true
 	srfh.rotateOnce()
+	srfh.queue.doneWG.Add(1)
+	go func() {
+		defer srfh.queue.doneWG.Done()
+		srfh.runWriter()
+	}()
+}
+
+func (srfh *SizeRotatingFileHandler) runWriter() {
+	for b := range srfh.queue.ch {
+		srfh.fileLock.RLock()
+		srfh.log.Print(string(b))
+		srfh.fileLock.RUnlock()
+		srfh.rotating()
+	}
+	srfh.fileLock.RLock()
+	srfh.fileFd.Sync()
+	srfh.fileLock.RUnlock()
 }
 
-func (srfh SizeRotatingFileHandler) Name() string {
+func (srfh *SizeRotatingFileHandler) Name() string {
 	return srfh.name
 }
 
 func (srfh *SizeRotatingFileHandler) Close() error {
+	srfh.drain()
 	srfh.rotateOnce()
+	srfh.compressor.wg.Wait()
 	srfh.fileCount = 0
 	srfh.fileSize = 0
 	srfh.nextSuffix = 0
@@ -134,30 +346,36 @@ func (srfh *SizeRotatingFileHandler) SetFlags(flag int) {
 	srfh.log.SetFlags(flag)
 }
 
-func (srfh *SizeRotatingFileHandler) isRotatingRun() bool {
-	srfh.rotatingLock.RLock()
-	defer srfh.rotatingLock.RUnlock()
-	return srfh.rotatingRun
-}
-
-func (srfh *SizeRotatingFileHandler) setRotatingRun(bRun bool) {
+// dueForCheck reports whether it's time to stat the active file again,
+// advancing the next eligible check time if so. It never blocks, which
+// matters now that the size check runs inline on the single writer
+// goroutine instead of a spawned-per-write goroutine.
+func (srfh *SizeRotatingFileHandler) dueForCheck() bool {
 	srfh.rotatingLock.Lock()
 	defer srfh.rotatingLock.Unlock()
-	srfh.rotatingRun = bRun
+	if time.Now().Before(srfh.nextCheckAt) {
+		return false
+	}
+	srfh.nextCheckAt = time.Now().Add(time.Duration(srfh.rotatingInterval) * time.Millisecond)
+	return true
 }
 
 func (srfh *SizeRotatingFileHandler) rotateOnce() {
 	srfh.fileLock.Lock()
-	defer srfh.fileLock.Unlock()
 	fileinfo, err := os.Stat(srfh.filePath)
 	if err != nil {
+		srfh.fileLock.Unlock()
+		// srfh.Log takes fileLock's read side via Write, so it must run
+		// after the write lock above is released or it deadlocks.
 		srfh.Log("ERROR cat not get %s status. quit rotating.", srfh.Name())
 		return
 	}
+	defer srfh.fileLock.Unlock()
 	if fileinfo.Size() >= srfh.fileSize {
 		flag := srfh.log.Flags()
 		srfh.fileFd.Close()
-		os.Rename(srfh.filePath, fmt.Sprintf("%s.%d", srfh.filePath, srfh.nextSuffix))
+		rotatedSuffix := srfh.nextSuffix
+		os.Rename(srfh.filePath, fmt.Sprintf("%s.%d", srfh.filePath, rotatedSuffix))
 		srfh.fileFd, _ = os.OpenFile(srfh.filePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
 		srfh.log = log.New(srfh.fileFd, "", flag)
 		if srfh.nextSuffix >= (srfh.fileCount - 1) {
@@ -165,17 +383,17 @@ func (srfh *SizeRotatingFileHandler) rotateOnce() {
 		} else {
 			srfh.nextSuffix++
 		}
+		if srfh.compress {
+			srfh.startCompress(fmt.Sprintf("%s.%d", srfh.filePath, rotatedSuffix))
+		}
 	}
 }
 
 func (srfh *SizeRotatingFileHandler) rotating() {
-	if srfh.nextSuffix == 0 || srfh.isRotatingRun() {
+	if srfh.nextSuffix == 0 || !srfh.dueForCheck() {
 		return
 	}
-	srfh.setRotatingRun(true)
 	srfh.rotateOnce()
-	time.Sleep(time.Duration(srfh.rotatingInterval)*time.Millisecond)
-	srfh.setRotatingRun(false)
 }
 
 func (srfh *SizeRotatingFileHandler) checkNextSuffix() {
@@ -185,7 +403,13 @@ func (srfh *SizeRotatingFileHandler) checkNextSuffix() {
 	var minModTime int64
 	for n := 1; n < srfh.fileCount; n++ {
 		filepath := fmt.Sprintf("%s.%d", srfh.filePath, n)
-		if fileinfo, err := os.Stat(filepath); !os.IsNotExist(err) {
+		fileinfo, err := os.Stat(filepath)
+		if os.IsNotExist(err) {
+			if gzinfo, gzerr := os.Stat(filepath + ".gz"); !os.IsNotExist(gzerr) {
+				fileinfo, err = gzinfo, gzerr
+			}
+		}
+		if !os.IsNotExist(err) {
 			if (minModTime == 0 || minModTime > fileinfo.ModTime().Unix()) {
 				minModTime = fileinfo.ModTime().Unix()
 				srfh.nextSuffix = n
@@ -199,6 +423,21 @@ func (srfh *SizeRotatingFileHandler) checkNextSuffix() {
 
 func NewSizeRotatingFileHandler(
 	name string, filePath string, fileCount int, fileSize int64,
+) (*SizeRotatingFileHandler, error) {
+	return newSizeRotatingFileHandler(name, filePath, fileCount, fileSize, false)
+}
+
+// NewSizeRotatingFileHandlerWithCompression behaves like
+// NewSizeRotatingFileHandler but additionally gzips each rotated-out
+// file in the background, replacing <path>.<N> with <path>.<N>.gz.
+func NewSizeRotatingFileHandlerWithCompression(
+	name string, filePath string, fileCount int, fileSize int64,
+) (*SizeRotatingFileHandler, error) {
+	return newSizeRotatingFileHandler(name, filePath, fileCount, fileSize, true)
+}
+
+func newSizeRotatingFileHandler(
+	name string, filePath string, fileCount int, fileSize int64, compress bool,
 ) (*SizeRotatingFileHandler, error) {
 	fh, err := NewFileHandler(name, filePath)
 	if err != nil {
@@ -222,7 +461,7 @@ func NewSizeRotatingFileHandler(
 	switch {
 		case nSize < 10*KB:
 			nInterval = 0
-		case nSize <= MB: 
+		case nSize <= MB:
 			nInterval = 100
 		case nSize <= 100*MB:
 			nInterval = 10000
@@ -240,8 +479,8 @@ func NewSizeRotatingFileHandler(
 		nextSuffix       : nSuffix,
 		running          : false,
 		rotatingLock     : new(sync.RWMutex),
-		rotatingRun      : false,
 		rotatingInterval : nInterval,
+		compress         : compress,
 	}
 	srfh.checkNextSuffix()
 	return srfh, nil
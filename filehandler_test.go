@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestSizeRotatingFileHandlerConcurrentLogAndRotation exercises the exact
+// pattern the chunk0-3 redesign introduced: several goroutines reading
+// IsOff and Name off the Handler interface and then calling Log, while
+// the single writer goroutine runs dueForCheck and rotateOnce inline. Run with -race; it catches a struct-copy data
+// race on nextCheckAt/nextSuffix if IsOff/Name ever regress back to
+// value receivers.
+func TestSizeRotatingFileHandlerConcurrentLogAndRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	srfh, err := NewSizeRotatingFileHandlerWithCompression("srfh", path, 3, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srfh.Run()
+
+	var handler Handler = srfh
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if handler.IsOff() {
+					continue
+				}
+				if got := handler.Name(); got != "srfh" {
+					t.Errorf("Name() = %q, want %q", got, "srfh")
+					return
+				}
+				handler.Log("worker %d padding padding padding %d", id, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := srfh.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Formatter turns a single log call into the final bytes a Handler
+// writes to its destination. Logger formats a message once via its
+// Formatter and hands the same []byte to every handler, rather than
+// letting each handler format it independently.
+type Formatter interface {
+	Format(level LEVEL, t time.Time, msg string, fields map[string]any) []byte
+}
+
+// TextFormatter reproduces Logger's original "LEVEL message" line,
+// appending any fields as "key=value" pairs. Handlers still prepend
+// their own timestamp (DEFLOGFLAG) when they print it.
+type TextFormatter struct{}
+
+func (TextFormatter) Format(level LEVEL, t time.Time, msg string, fields map[string]any) []byte {
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for _, k := range sortedKeys(fields) {
+		fmt.Fprintf(&b, " %s=%v", k, fields[k])
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// JSONFormatter emits one JSON object per line with ts, level, msg, and
+// any fields attached via Logger.With or passed to an *w method. Pair it
+// with handler.SetFlags(0) if the handler's own std-log timestamp prefix
+// should be dropped so each line is valid JSON on its own.
+type JSONFormatter struct{}
+
+func (JSONFormatter) Format(level LEVEL, t time.Time, msg string, fields map[string]any) []byte {
+	entry := make(map[string]any, len(fields)+3)
+	for k, v := range fields {
+		entry[k] = v
+	}
+	entry["ts"] = t.Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		b = []byte(fmt.Sprintf(`{"ts":%q,"level":%q,"msg":%q}`, t.Format(time.RFC3339Nano), level.String(), msg))
+	}
+	return append(b, '\n')
+}
+
+func sortedKeys(fields map[string]any) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,21 +1,113 @@
 package logging
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"sync"
+	"sync/atomic"
 )
 
 const (
 	DEFLOGFLAG = log.LstdFlags | log.Lmicroseconds
 )
 
+// DefaultQueueSize is the buffered channel size a handler uses when none
+// is set explicitly via SetQueueSize.
+const DefaultQueueSize = 100
+
+// OverflowPolicy controls what a handler's write queue does once its
+// buffer is full.
+type OverflowPolicy int
+
+const (
+	// DropOldest discards the oldest queued message to make room for
+	// the new one.
+	DropOldest OverflowPolicy = iota
+	// Block makes the caller wait until the writer goroutine frees up
+	// space in the queue.
+	Block
+)
+
+// HandlerStats reports a handler's write-queue health.
+type HandlerStats struct {
+	Dropped uint64
+}
+
 type Handler interface {
 	Log(format string, v ...interface{})
+	// Write accepts an already-formatted line (see Formatter) so a
+	// Logger with multiple handlers only formats each message once.
+	Write(b []byte)
 	Off()
 	IsOff() bool
 	Close() error
 	Run()
 	Name() string
+	Stats() HandlerStats
+}
+
+// writeQueue buffers formatted log messages between the caller's
+// goroutine and a handler's single writer goroutine.
+type writeQueue struct {
+	ch        chan []byte
+	policy    OverflowPolicy
+	dropped   uint64
+	closed    bool
+	closeLock sync.RWMutex
+	doneWG    sync.WaitGroup
+	closeOnce sync.Once
+}
+
+func newWriteQueue(size int, policy OverflowPolicy) *writeQueue {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	return &writeQueue{
+		ch:     make(chan []byte, size),
+		policy: policy,
+	}
+}
+
+// enqueue sends b to the writer goroutine. It holds closeLock for the
+// whole send so close() can't close the channel out from under it, which
+// would otherwise panic with "send on closed channel" if a caller logs
+// concurrently with Close().
+func (q *writeQueue) enqueue(b []byte) {
+	q.closeLock.RLock()
+	defer q.closeLock.RUnlock()
+	if q.closed {
+		return
+	}
+	if q.policy == Block {
+		q.ch <- b
+		return
+	}
+	for {
+		select {
+		case q.ch <- b:
+			return
+		default:
+			select {
+			case <-q.ch:
+				atomic.AddUint64(&q.dropped, 1)
+			default:
+			}
+		}
+	}
+}
+
+func (q *writeQueue) close() {
+	q.closeOnce.Do(func() {
+		q.closeLock.Lock()
+		q.closed = true
+		q.closeLock.Unlock()
+		close(q.ch)
+	})
+}
+
+func (q *writeQueue) stats() HandlerStats {
+	return HandlerStats{Dropped: atomic.LoadUint64(&q.dropped)}
 }
 
 type StdHandler struct {
@@ -25,8 +117,12 @@ type StdHandler struct {
 }
 
 func (h StdHandler) Log(format string, v ...interface{}) {
+	h.Write([]byte(fmt.Sprintf(format, v...)))
+}
+
+func (h StdHandler) Write(b []byte) {
 	if h.log != nil {
-		h.log.Printf(format, v...)
+		h.log.Print(string(b))
 	}
 }
 
@@ -46,6 +142,10 @@ func (h StdHandler) Name() string {
 	return h.name
 }
 
+func (h StdHandler) Stats() HandlerStats {
+	return HandlerStats{}
+}
+
 func (h *StdHandler) Close() error {
 	h.name = ""
 	h.off = true
@@ -3,6 +3,7 @@ package logging
 import (
 	"fmt"
 	"os"
+	"time"
 )
 
 const (
@@ -41,8 +42,10 @@ func (level LEVEL) String() string {
 }
 
 type Logger struct {
-	logLevel LEVEL
-	handlers []Handler
+	logLevel  LEVEL
+	handlers  []Handler
+	formatter Formatter
+	fields    map[string]any
 }
 
 func (l *Logger) SetLevel(level LEVEL) {
@@ -51,6 +54,35 @@ func (l *Logger) SetLevel(level LEVEL) {
 	}
 }
 
+// SetFormatter chooses how log calls are turned into the bytes each
+// handler writes. It defaults to TextFormatter.
+func (l *Logger) SetFormatter(f Formatter) {
+	l.formatter = f
+}
+
+// With returns a child logger that attaches k/v to every message it
+// logs, in addition to any fields already attached to l.
+func (l Logger) With(k string, v any) *Logger {
+	fields := make(map[string]any, len(l.fields)+1)
+	for key, val := range l.fields {
+		fields[key] = val
+	}
+	fields[k] = v
+	return &Logger{
+		logLevel:  l.logLevel,
+		handlers:  l.handlers,
+		formatter: l.formatter,
+		fields:    fields,
+	}
+}
+
+func (l Logger) formatterOrDefault() Formatter {
+	if l.formatter != nil {
+		return l.formatter
+	}
+	return TextFormatter{}
+}
+
 func (l *Logger) AddHandler(h Handler) error {
 	for _, handler := range l.handlers {
 		if handler.Name() == h.Name() {
@@ -69,15 +101,56 @@ func (l *Logger) Close() {
 	l.handlers = nil
 }
 
+// flush blocks until every handler's writer goroutine has drained its
+// queue, so the message Fatal just logged isn't lost to a handler's
+// asynchronous write path when os.Exit runs right after.
+func (l Logger) flush() {
+	for _, handler := range l.handlers {
+		handler.Close()
+	}
+}
+
 func (l Logger) log(level LEVEL, format string, v ...interface{}) {
-	if l.logLevel <= level {
-		for _, handler := range l.handlers {
-			if !handler.IsOff() {
-				f := fmt.Sprintf("%s %s\n", level.String(), format)
-				handler.Log(f, v...)
-			}
+	if l.logLevel > level {
+		return
+	}
+	msg := fmt.Sprintf(format, v...)
+	b := l.formatterOrDefault().Format(level, time.Now(), msg, l.fields)
+	for _, handler := range l.handlers {
+		if !handler.IsOff() {
+			handler.Write(b)
+		}
+	}
+}
+
+// logw is the key/value counterpart of log, used by the *w methods.
+func (l Logger) logw(level LEVEL, msg string, kv ...any) {
+	if l.logLevel > level {
+		return
+	}
+	b := l.formatterOrDefault().Format(level, time.Now(), msg, mergeFields(l.fields, kv))
+	for _, handler := range l.handlers {
+		if !handler.IsOff() {
+			handler.Write(b)
+		}
+	}
+}
+
+// mergeFields overlays kv (alternating key, value) onto base, returning
+// a new map so callers never mutate a Logger's own fields.
+func mergeFields(base map[string]any, kv []any) map[string]any {
+	fields := make(map[string]any, len(base)+len(kv)/2)
+	for k, v := range base {
+		fields[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			continue
 		}
+		fields[key] = kv[i+1]
 	}
+	return fields
 }
 
 func (l Logger) Debug(format string, v ...interface{}) {
@@ -98,6 +171,31 @@ func (l Logger) Error(format string, v ...interface{}) {
 
 func (l Logger) Fatal(format string, v ...interface{}) {
 	l.log(FATAL, format, v...)
+	l.flush()
+	os.Exit(-1)
+}
+
+// Debugw logs msg at DEBUG with alternating key/value pairs attached as
+// fields, in addition to any fields from With.
+func (l Logger) Debugw(msg string, kv ...any) {
+	l.logw(DEBUG, msg, kv...)
+}
+
+func (l Logger) Infow(msg string, kv ...any) {
+	l.logw(INFO, msg, kv...)
+}
+
+func (l Logger) Warningw(msg string, kv ...any) {
+	l.logw(WARNING, msg, kv...)
+}
+
+func (l Logger) Errorw(msg string, kv ...any) {
+	l.logw(ERROR, msg, kv...)
+}
+
+func (l Logger) Fatalw(msg string, kv ...any) {
+	l.logw(FATAL, msg, kv...)
+	l.flush()
 	os.Exit(-1)
 }
 
@@ -123,3 +221,23 @@ func NewSRFileLogger(filePath string, fileCount int, fileSize int64) (*Logger, e
 	logger.AddHandler(srfilehandler)
 	return logger, nil
 }
+
+func NewSRFileLoggerWithCompression(filePath string, fileCount int, fileSize int64) (*Logger, error) {
+	srfilehandler, err := NewSizeRotatingFileHandlerWithCompression("SizeRotatingFileHandler", filePath, fileCount, fileSize)
+	if err != nil {
+		return nil, err
+	}
+	logger := NewLogger()
+	logger.AddHandler(srfilehandler)
+	return logger, nil
+}
+
+func NewDailyFileLogger(filePath string, keepDays int, compress bool) (*Logger, error) {
+	dailyhandler, err := NewDailyRotatingFileHandler("DailyRotatingFileHandler", filePath, keepDays, compress)
+	if err != nil {
+		return nil, err
+	}
+	logger := NewLogger()
+	logger.AddHandler(dailyhandler)
+	return logger, nil
+}
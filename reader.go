@@ -0,0 +1,348 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ReadConfig controls how (fh *FileHandler) ReadLogs replays a log file.
+type ReadConfig struct {
+	// Tail limits the result to the last N lines across the active file
+	// and its rotated siblings. Zero means no limit.
+	Tail int
+	// Since drops lines whose parsed timestamp is older than it. Zero
+	// value disables the filter.
+	Since time.Time
+	// Follow keeps the LogWatcher open and streams new writes to the
+	// active file, resuming after a rotation, until Close is called.
+	Follow bool
+}
+
+// LogWatcher streams lines from a FileHandler the way `docker logs`
+// streams from its json-file driver.
+type LogWatcher struct {
+	Msg <-chan []byte
+	Err <-chan error
+
+	closeOnce   sync.Once
+	closeNotify chan struct{}
+}
+
+func newLogWatcher() (*LogWatcher, chan []byte, chan error) {
+	msgChan := make(chan []byte)
+	errChan := make(chan error, 1)
+	return &LogWatcher{
+		Msg:         msgChan,
+		Err:         errChan,
+		closeNotify: make(chan struct{}),
+	}, msgChan, errChan
+}
+
+// Close stops the watcher. It is safe to call more than once.
+func (w *LogWatcher) Close() {
+	w.closeOnce.Do(func() {
+		close(w.closeNotify)
+	})
+}
+
+// ReadLogs enumerates the active file and its rotated siblings
+// (transparently decompressing .gz archives), replays cfg.Tail/cfg.Since,
+// and optionally follows the active file for new writes.
+func (fh *FileHandler) ReadLogs(cfg ReadConfig) *LogWatcher {
+	watcher, msgChan, errChan := newLogWatcher()
+	go fh.readLogs(cfg, watcher, msgChan, errChan)
+	return watcher
+}
+
+func (fh *FileHandler) readLogs(cfg ReadConfig, watcher *LogWatcher, msgChan chan []byte, errChan chan error) {
+	defer close(msgChan)
+
+	files, err := fh.rotatedSiblings()
+	if err != nil {
+		errChan <- err
+		return
+	}
+	files = append(files, fh.filePath)
+
+	lines, err := tailLines(files, fh.refCounter, cfg.Tail)
+	if err != nil {
+		errChan <- err
+		return
+	}
+	lines = filterSince(lines, cfg.Since)
+
+	for _, line := range lines {
+		select {
+		case msgChan <- line:
+		case <-watcher.closeNotify:
+			return
+		}
+	}
+
+	if !cfg.Follow {
+		return
+	}
+	fh.followActive(watcher, msgChan, errChan)
+}
+
+// rotatedSiblings returns <path>.<N> and <path>.<N>.gz files in
+// chronological order, oldest first. In-progress ".gz.tmp" archives
+// (see FileHandler.compressToGz) are excluded since they aren't valid
+// gzip streams until renamed into place.
+func (fh *FileHandler) rotatedSiblings() ([]string, error) {
+	matches, err := filepath.Glob(fh.filePath + ".*")
+	if err != nil {
+		return nil, err
+	}
+	filtered := matches[:0]
+	for _, m := range matches {
+		if filepath.Ext(m) == ".tmp" {
+			continue
+		}
+		filtered = append(filtered, m)
+	}
+	matches = filtered
+	sort.Slice(matches, func(i, j int) bool {
+		fi, erri := os.Stat(matches[i])
+		fj, errj := os.Stat(matches[j])
+		if erri != nil || errj != nil {
+			return false
+		}
+		return fi.ModTime().Before(fj.ModTime())
+	})
+	return matches, nil
+}
+
+// tailLines collects the last n lines (0 means all) across files, which
+// must already be in chronological order.
+func tailLines(files []string, refc *refCounter, n int) ([][]byte, error) {
+	var collected [][]byte
+	for i := len(files) - 1; i >= 0; i-- {
+		want := n - len(collected)
+		if n > 0 && want <= 0 {
+			break
+		}
+		lines, err := tailFile(files[i], refc, want)
+		if err != nil {
+			continue
+		}
+		collected = append(lines, collected...)
+	}
+	return collected, nil
+}
+
+// tailFile returns the last n lines (0 means all) of a single rotated or
+// active file, decompressing it on the fly if it ends in .gz.
+func tailFile(path string, refc *refCounter, n int) ([][]byte, error) {
+	refc.acquire(path)
+	defer refc.release(path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if filepath.Ext(path) == ".gz" {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		return scanTail(gr, n)
+	}
+	return reverseTail(f, n)
+}
+
+// scanTail reads r forward, keeping only the last n lines in memory.
+// Used for .gz archives, which can't be seeked backward.
+func scanTail(r io.Reader, n int) ([][]byte, error) {
+	scanner := bufio.NewScanner(r)
+	var ring [][]byte
+	for scanner.Scan() {
+		line := append([]byte(nil), scanner.Bytes()...)
+		ring = append(ring, line)
+		if n > 0 && len(ring) > n {
+			ring = ring[1:]
+		}
+	}
+	return ring, scanner.Err()
+}
+
+// reverseTail seeks backward in chunks to collect the last n lines of a
+// plain file without reading it all into memory.
+func reverseTail(f *os.File, n int) ([][]byte, error) {
+	const chunkSize = 32 * 1024
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	pos := info.Size()
+	var buf []byte
+	var lines [][]byte
+	for pos > 0 {
+		readSize := int64(chunkSize)
+		if pos < readSize {
+			readSize = pos
+		}
+		pos -= readSize
+		chunk := make([]byte, readSize)
+		if _, err := f.ReadAt(chunk, pos); err != nil {
+			return nil, err
+		}
+		buf = append(chunk, buf...)
+		lines = bytes.Split(bytes.TrimSuffix(buf, []byte("\n")), []byte("\n"))
+		if n > 0 && len(lines) > n+1 && pos > 0 {
+			break
+		}
+	}
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// filterSince drops lines whose parsed standard-log timestamp is older
+// than since. Lines without a parseable timestamp are kept.
+func filterSince(lines [][]byte, since time.Time) [][]byte {
+	if since.IsZero() {
+		return lines
+	}
+	kept := lines[:0]
+	for _, line := range lines {
+		if t, ok := parseLogTime(line); ok && t.Before(since) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return kept
+}
+
+// logTimeLayout matches the prefix produced by DEFLOGFLAG
+// (log.LstdFlags | log.Lmicroseconds).
+const logTimeLayout = "2006/01/02 15:04:05.000000"
+
+func parseLogTime(line []byte) (time.Time, bool) {
+	if len(line) < len(logTimeLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(logTimeLayout, string(line[:len(logTimeLayout)]), time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// followActive tails the active file for new writes via fsnotify,
+// re-opening it whenever a rotation renames or removes it.
+func (fh *FileHandler) followActive(watcher *LogWatcher, msgChan chan []byte, errChan chan error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		errChan <- err
+		return
+	}
+	defer fw.Close()
+
+	if err := fw.Add(fh.filePath); err != nil {
+		errChan <- err
+		return
+	}
+
+	f, err := os.Open(fh.filePath)
+	if err != nil {
+		errChan <- err
+		return
+	}
+	defer f.Close()
+	f.Seek(0, io.SeekEnd)
+	reader := bufio.NewReader(f)
+
+	for {
+		select {
+		case <-watcher.closeNotify:
+			return
+		case event, ok := <-fw.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Write == fsnotify.Write {
+				if !drainLines(reader, msgChan, watcher.closeNotify) {
+					return
+				}
+				continue
+			}
+			if event.Op&(fsnotify.Rename|fsnotify.Remove) != 0 {
+				f.Close()
+				fw.Remove(fh.filePath)
+				newF, err := waitForReopen(fh.filePath, watcher.closeNotify)
+				if err != nil {
+					errChan <- err
+					return
+				}
+				if newF == nil {
+					return
+				}
+				f = newF
+				reader = bufio.NewReader(f)
+				if err := fw.Add(fh.filePath); err != nil {
+					errChan <- err
+					return
+				}
+			}
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return
+			}
+			errChan <- err
+		}
+	}
+}
+
+// drainLines forwards whatever complete lines are currently available,
+// returning false if the watcher was closed mid-drain.
+func drainLines(reader *bufio.Reader, msgChan chan []byte, closeNotify chan struct{}) bool {
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			select {
+			case msgChan <- line:
+			case <-closeNotify:
+				return false
+			}
+		}
+		if err != nil {
+			return true
+		}
+	}
+}
+
+// waitForReopen polls for the handler's active file to reappear after a
+// rotation swaps it out from under the reader.
+func waitForReopen(path string, closeNotify chan struct{}) (*os.File, error) {
+	var lastErr error
+	for i := 0; i < 50; i++ {
+		select {
+		case <-closeNotify:
+			return nil, nil
+		default:
+		}
+		f, err := os.Open(path)
+		if err == nil {
+			return f, nil
+		}
+		lastErr = err
+		time.Sleep(20 * time.Millisecond)
+	}
+	return nil, lastErr
+}